@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// authorizationCodeIssuer issues tokens via the OAuth2 Authorization Code flow with PKCE
+// (RFC 7636): it opens the system browser to the client's auth_url, waits for the redirect
+// on a local callback listener, and exchanges the returned code for a token.
+type authorizationCodeIssuer struct {
+	client Client
+}
+
+func (i authorizationCodeIssuer) Issue(ctx context.Context) (Token, error) {
+	client := i.client
+
+	verifier, err := generateCodeVerifier()
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+	challenge := codeChallengeS256(verifier)
+
+	state, err := randomURLSafeString(32)
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to generate state: %w", err)
+	}
+
+	redirectURI := fmt.Sprintf("http://127.0.0.1:%d/callback", client.RedirectPort)
+
+	authURL, err := buildAuthURL(client, redirectURI, state, challenge)
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to build authorization url: %w", err)
+	}
+
+	codeCh := make(chan string, 1)
+	errCh := make(chan error, 1)
+
+	srv := startCallbackServer(client.RedirectPort, state, codeCh, errCh)
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("opening browser for authorization", "auth_url", client.AuthURL)
+	if err := openBrowser(authURL); err != nil {
+		slog.Warn("failed to open browser automatically, please open it manually", "url", authURL, "error", err.Error())
+	}
+
+	var code string
+	select {
+	case code = <-codeCh:
+	case err := <-errCh:
+		return Token{}, err
+	case <-ctx.Done():
+		return Token{}, ctx.Err()
+	case <-time.After(5 * time.Minute):
+		return Token{}, fmt.Errorf("timed out waiting for authorization redirect")
+	}
+
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("code", code)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("code_verifier", verifier)
+
+	return postFormToken(client, data)
+}
+
+// buildAuthURL constructs the authorization endpoint URL with the PKCE challenge and state.
+func buildAuthURL(client Client, redirectURI, state, challenge string) (string, error) {
+	u, err := url.Parse(client.AuthURL)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", client.Id)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("state", state)
+	q.Set("code_challenge", challenge)
+	q.Set("code_challenge_method", "S256")
+	if len(client.Scopes) > 0 {
+		q.Set("scope", strings.Join(client.Scopes, " "))
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// startCallbackServer spins up a local http.Server on 127.0.0.1:port that handles the
+// authorization redirect, validates state, and delivers the code (or an error) on the
+// provided channels.
+func startCallbackServer(port int, state string, codeCh chan<- string, errCh chan<- error) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		if errParam := q.Get("error"); errParam != "" {
+			errCh <- fmt.Errorf("authorization server returned error: %s (%s)", errParam, q.Get("error_description"))
+			http.Error(w, "authorization failed, you may close this window", http.StatusBadRequest)
+			return
+		}
+
+		if q.Get("state") != state {
+			errCh <- fmt.Errorf("state mismatch in authorization redirect")
+			http.Error(w, "state mismatch, you may close this window", http.StatusBadRequest)
+			return
+		}
+
+		code := q.Get("code")
+		if code == "" {
+			errCh <- fmt.Errorf("no code present in authorization redirect")
+			http.Error(w, "missing code, you may close this window", http.StatusBadRequest)
+			return
+		}
+
+		fmt.Fprintln(w, "Authorization complete, you may close this window.")
+		codeCh <- code
+	})
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf("127.0.0.1:%d", port),
+		Handler: mux,
+	}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errCh <- fmt.Errorf("callback listener failed: %w", err)
+		}
+	}()
+
+	return srv
+}
+
+// generateCodeVerifier returns a random URL-safe string suitable for use as a PKCE
+// code_verifier (RFC 7636 requires 43-128 characters).
+func generateCodeVerifier() (string, error) {
+	return randomURLSafeString(64)
+}
+
+// codeChallengeS256 derives the PKCE S256 code_challenge from a code_verifier.
+func codeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// randomURLSafeString returns a base64url (no padding) encoded string of n random bytes.
+func randomURLSafeString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// openBrowser opens the given URL in the user's default browser.
+func openBrowser(target string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", target).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", target).Start()
+	default:
+		return exec.Command("xdg-open", target).Start()
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/zalando/go-keyring"
+)
+
+// Cache reads and writes a client's token cache file, optionally encrypting its contents.
+type Cache interface {
+	Read(path string) ([]byte, error)
+	Write(path string, data []byte) error
+}
+
+// newCache selects the Cache implementation for a client's configured cache_encryption.
+// The empty string keeps the historical plaintext-on-disk behaviour.
+func newCache(client Client) Cache {
+	switch client.CacheEncryption {
+	case "keyring":
+		return keyringCache{}
+	default:
+		return plaintextCache{}
+	}
+}
+
+// plaintextCache stores the token cache as plain JSON, as oauth2_token has always done.
+type plaintextCache struct{}
+
+func (plaintextCache) Read(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (plaintextCache) Write(path string, data []byte) error {
+	return writeCacheFile(path, data)
+}
+
+// keyringService is the service name under which per-cache-file encryption keys are stored.
+const keyringService = "oauth2_token"
+
+// keyringCache stores the token cache as an AES-GCM ciphertext, with the symmetric key held
+// in the OS keyring (Keychain / Credential Manager / libsecret, via go-keyring).
+type keyringCache struct{}
+
+func (keyringCache) Read(path string) ([]byte, error) {
+	ciphertext, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := keyringKey(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cache encryption key: %w", err)
+	}
+
+	return decryptAESGCM(key, ciphertext)
+}
+
+func (keyringCache) Write(path string, data []byte) error {
+	key, err := keyringKey(path)
+	if err != nil {
+		return fmt.Errorf("failed to load cache encryption key: %w", err)
+	}
+
+	ciphertext, err := encryptAESGCM(key, data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt cache file: %w", err)
+	}
+
+	return writeCacheFile(path, ciphertext)
+}
+
+// keyringKey fetches the AES-256 key used to encrypt the cache file at path, generating and
+// storing one in the OS keyring the first time it's needed.
+func keyringKey(path string) ([]byte, error) {
+	account := filepath.Base(path)
+
+	if encoded, err := keyring.Get(keyringService, account); err == nil {
+		return base64.StdEncoding.DecodeString(encoded)
+	} else if err != keyring.ErrNotFound {
+		return nil, fmt.Errorf("failed to read key from keyring: %w", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate cache encryption key: %w", err)
+	}
+
+	if err := keyring.Set(keyringService, account, base64.StdEncoding.EncodeToString(key)); err != nil {
+		return nil, fmt.Errorf("failed to store key in keyring: %w", err)
+	}
+
+	return key, nil
+}
+
+func encryptAESGCM(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func decryptAESGCM(key, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("cache file is too short to be valid ciphertext")
+	}
+	nonce, ct := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ct, nil)
+}
+
+// writeCacheFile writes data to path, restricting access to the current user. The unix
+// permission bits alone do not scope access on Windows, so restrictToCurrentUser additionally
+// applies a platform-appropriate ACL; see cache_windows.go and cache_unix.go.
+func writeCacheFile(path string, data []byte) error {
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	return restrictToCurrentUser(path)
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// restrictToCurrentUser restricts path to the owning user via the standard unix permission
+// bits. os.WriteFile already created the file with mode 0600; Chmod guards against a more
+// permissive umask.
+func restrictToCurrentUser(path string) error {
+	return os.Chmod(path, 0600)
+}
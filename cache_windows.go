@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+import "github.com/hectane/go-acl"
+
+// restrictToCurrentUser applies a Windows ACL restricting path to the current user, since
+// os.Chmod on Windows only toggles the read-only attribute and cannot scope access to an ACL.
+func restrictToCurrentUser(path string) error {
+	return acl.Chmod(path, 0600)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// clientAuth applies the client's configured auth_method to an outgoing token request. It may
+// add parameters to data (client_secret_post, private_key_jwt, tls_client_auth) and returns
+// the *http.Client the request should be sent with, plus an Authorization header value to set
+// (empty if none is needed).
+func clientAuth(client Client, data url.Values) (*http.Client, string, error) {
+	switch client.AuthMethod {
+	case "", "client_secret_basic":
+		return http.DefaultClient, "Basic " + base64.StdEncoding.EncodeToString([]byte(client.Id+":"+client.Secret)), nil
+
+	case "client_secret_post":
+		data.Set("client_id", client.Id)
+		data.Set("client_secret", client.Secret)
+		return http.DefaultClient, "", nil
+
+	case "private_key_jwt":
+		assertion, err := buildClientAssertionJWT(client)
+		if err != nil {
+			return nil, "", err
+		}
+		data.Set("client_id", client.Id)
+		data.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+		data.Set("client_assertion", assertion)
+		return http.DefaultClient, "", nil
+
+	case "tls_client_auth":
+		httpClient, err := mtlsHTTPClient(client)
+		if err != nil {
+			return nil, "", err
+		}
+		data.Set("client_id", client.Id)
+		return httpClient, "", nil
+
+	default:
+		return nil, "", fmt.Errorf("unsupported auth_method %q", client.AuthMethod)
+	}
+}
+
+// buildClientAssertionJWT signs a client_assertion JWT per RFC 7523 using the client's
+// configured private_key_file (PEM-encoded RSA or EC key).
+func buildClientAssertionJWT(client Client) (string, error) {
+	keyPEM, err := os.ReadFile(client.PrivateKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read private_key_file: %w", err)
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return "", fmt.Errorf("private_key_file %q does not contain PEM data", client.PrivateKeyFile)
+	}
+
+	jti, err := randomURLSafeString(16)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate jti: %w", err)
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": client.Id,
+		"sub": client.Id,
+		"aud": client.Base,
+		"jti": jti,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+	}
+
+	signingMethod, signingKey, err := parsePrivateKey(block)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(signingMethod, claims)
+	if client.KeyID != "" {
+		token.Header["kid"] = client.KeyID
+	}
+
+	return token.SignedString(signingKey)
+}
+
+// parsePrivateKey parses a PEM block holding an RSA or EC private key and returns the JWT
+// signing method appropriate for it. PKCS#8 "PRIVATE KEY" blocks (the default output of e.g.
+// `openssl genpkey`) are inspected by their parsed key type rather than assumed to be RSA,
+// since both RSA and EC keys are commonly stored in that form.
+func parsePrivateKey(block *pem.Block) (jwt.SigningMethod, any, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse RSA private key: %w", err)
+		}
+		return jwt.SigningMethodRS256, key, nil
+
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse EC private key: %w", err)
+		}
+		method, err := esSigningMethod(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		return method, key, nil
+
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse PKCS8 private key: %w", err)
+		}
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			return jwt.SigningMethodRS256, key, nil
+		case *ecdsa.PrivateKey:
+			method, err := esSigningMethod(key)
+			if err != nil {
+				return nil, nil, err
+			}
+			return method, key, nil
+		default:
+			return nil, nil, fmt.Errorf("unsupported PKCS8 private key type %T in private_key_file", key)
+		}
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported private key type %q in private_key_file", block.Type)
+	}
+}
+
+// esSigningMethod selects the JWT ECDSA signing method matching key's curve, since signing a
+// P-384/P-521 key with ES256 (or vice versa) is rejected by the token endpoint.
+func esSigningMethod(key *ecdsa.PrivateKey) (jwt.SigningMethod, error) {
+	switch key.Curve {
+	case elliptic.P256():
+		return jwt.SigningMethodES256, nil
+	case elliptic.P384():
+		return jwt.SigningMethodES384, nil
+	case elliptic.P521():
+		return jwt.SigningMethodES512, nil
+	default:
+		return nil, fmt.Errorf("unsupported EC curve %s in private_key_file", key.Curve.Params().Name)
+	}
+}
+
+// mtlsHTTPClient builds an *http.Client that presents the client's configured certificate for
+// TLS client authentication (RFC 8705).
+func mtlsHTTPClient(client Client) (*http.Client, error) {
+	cert, err := tls.LoadX509KeyPair(client.ClientCertFile, client.ClientKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				Certificates: []tls.Certificate{cert},
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oidcDiscoveryDocument is the subset of an OIDC provider's
+// ".well-known/openid-configuration" document that oauth2_token needs.
+type oidcDiscoveryDocument struct {
+	Issuer                string   `json:"issuer"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	GrantTypesSupported   []string `json:"grant_types_supported"`
+}
+
+// warnIfGrantTypeUnsupported logs a warning if the discovery document advertises
+// grant_types_supported and client's configured grant_type isn't among them.
+func warnIfGrantTypeUnsupported(client Client, discovery *oidcDiscoveryDocument) {
+	if len(discovery.GrantTypesSupported) == 0 {
+		return
+	}
+
+	grantType := client.GrantType
+	if grantType == "" {
+		grantType = "client_credentials"
+	}
+
+	if !slices.Contains(discovery.GrantTypesSupported, grantType) {
+		slog.Warn(
+			"grant_type is not advertised by the OIDC discovery document",
+			"grant_type", grantType,
+			"grant_types_supported", discovery.GrantTypesSupported,
+		)
+	}
+}
+
+// loadDiscoveryDocument fetches a client's OIDC discovery document, caching it alongside the
+// token cache file so it's only fetched once per issuer.
+func loadDiscoveryDocument(issuer string) (*oidcDiscoveryDocument, error) {
+	cacheFile := filepath.Join(cacheDir(), cacheFilename(issuer, "discovery")+".json")
+
+	if bs, err := os.ReadFile(cacheFile); err == nil {
+		var doc oidcDiscoveryDocument
+		if err := json.Unmarshal(bs, &doc); err == nil {
+			return &doc, nil
+		}
+	}
+
+	wellKnownURL := strings.TrimRight(issuer, "/") + "/.well-known/openid-configuration"
+
+	resp, err := http.Get(wellKnownURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bs, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read discovery document: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch discovery document: status_code=%d response_body=%s", resp.StatusCode, string(bs))
+	}
+
+	var doc oidcDiscoveryDocument
+	if err := json.Unmarshal(bs, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse discovery document: %w", err)
+	}
+
+	_ = os.WriteFile(cacheFile, bs, 0640)
+
+	return &doc, nil
+}
+
+// printIDTokenClaims validates idToken's signature against the issuer's JWKS (refetching on
+// an unrecognised kid to support key rotation), validates iss/aud/exp/nbf/iat, and prints the
+// parsed claims as JSON.
+func printIDTokenClaims(idToken string, client Client, discovery *oidcDiscoveryDocument) error {
+	if idToken == "" {
+		return fmt.Errorf("token response did not include an id_token")
+	}
+	if discovery == nil || discovery.JWKSURI == "" {
+		return fmt.Errorf("discovery_url must be configured to validate an id_token")
+	}
+
+	k, err := keyfunc.NewDefaultCtx(context.Background(), []string{discovery.JWKSURI})
+	if err != nil {
+		return fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(idToken, claims, k.Keyfunc,
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(client.Id),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return fmt.Errorf("id_token validation failed: %w", err)
+	}
+	if !token.Valid {
+		return fmt.Errorf("id_token is not valid")
+	}
+
+	out, err := json.MarshalIndent(claims, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal id_token claims: %w", err)
+	}
+
+	fmt.Println(string(out))
+	return nil
+}
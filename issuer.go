@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TokenIssuer obtains a token for a Client using a particular OAuth2 (or related) grant.
+type TokenIssuer interface {
+	Issue(ctx context.Context) (Token, error)
+}
+
+// newIssuer selects the TokenIssuer for a client's configured grant_type. The empty string
+// is treated as "client_credentials" for backward compatibility.
+func newIssuer(client Client) (TokenIssuer, error) {
+	switch client.GrantType {
+	case "", "client_credentials":
+		return clientCredentialsIssuer{client}, nil
+	case "password":
+		return passwordIssuer{client}, nil
+	case "authorization_code":
+		return authorizationCodeIssuer{client}, nil
+	case "urn:ietf:params:oauth:grant-type:jwt-bearer":
+		return jwtBearerIssuer{client}, nil
+	case "urn:ietf:params:oauth:grant-type:token-exchange":
+		return tokenExchangeIssuer{client}, nil
+	default:
+		return nil, fmt.Errorf("unsupported grant_type %q", client.GrantType)
+	}
+}
+
+// clientCredentialsIssuer performs the OAuth2 Client Credentials flow.
+type clientCredentialsIssuer struct {
+	client Client
+}
+
+func (i clientCredentialsIssuer) Issue(_ context.Context) (Token, error) {
+	data := url.Values{}
+	data.Set("grant_type", "client_credentials")
+
+	return postFormToken(i.client, data)
+}
+
+// passwordIssuer performs the OAuth2 Resource Owner Password Credentials flow.
+type passwordIssuer struct {
+	client Client
+}
+
+func (i passwordIssuer) Issue(_ context.Context) (Token, error) {
+	data := url.Values{}
+	data.Set("grant_type", "password")
+	data.Set("username", i.client.Username)
+	data.Set("password", i.client.Password)
+	if len(i.client.Scopes) > 0 {
+		data.Set("scope", strings.Join(i.client.Scopes, " "))
+	}
+
+	return postFormToken(i.client, data)
+}
+
+// refreshTokenIssuer exchanges a refresh token for a new access token.
+type refreshTokenIssuer struct {
+	client       Client
+	refreshToken string
+}
+
+func (i refreshTokenIssuer) Issue(_ context.Context) (Token, error) {
+	data := url.Values{}
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", i.refreshToken)
+
+	return postFormToken(i.client, data)
+}
+
+// jwtBearerIssuer performs the JWT Bearer flow (RFC 7523) using a pre-signed assertion,
+// e.g. for service-account style authentication.
+type jwtBearerIssuer struct {
+	client Client
+}
+
+func (i jwtBearerIssuer) Issue(_ context.Context) (Token, error) {
+	data := url.Values{}
+	data.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	data.Set("assertion", i.client.Assertion)
+	if len(i.client.Scopes) > 0 {
+		data.Set("scope", strings.Join(i.client.Scopes, " "))
+	}
+
+	return postFormToken(i.client, data)
+}
+
+// tokenExchangeIssuer performs the OAuth2 Token Exchange flow (RFC 8693), e.g. for workload
+// identity federation or impersonation chains.
+type tokenExchangeIssuer struct {
+	client Client
+}
+
+func (i tokenExchangeIssuer) Issue(_ context.Context) (Token, error) {
+	data := url.Values{}
+	data.Set("grant_type", "urn:ietf:params:oauth:grant-type:token-exchange")
+	data.Set("subject_token", i.client.SubjectToken)
+	data.Set("subject_token_type", "urn:ietf:params:oauth:token-type:access_token")
+	if i.client.Audience != "" {
+		data.Set("audience", i.client.Audience)
+	}
+	if len(i.client.Scopes) > 0 {
+		data.Set("scope", strings.Join(i.client.Scopes, " "))
+	}
+
+	return postFormToken(i.client, data)
+}
+
+// postFormToken POSTs data to the client's token endpoint and decodes the response as a Token.
+func postFormToken(client Client, data url.Values) (Token, error) {
+	respBody, err := postForm(client, data)
+	if err != nil {
+		return Token{}, err
+	}
+
+	var token Token
+	if err := json.NewDecoder(bytes.NewBuffer(respBody)).Decode(&token); err != nil {
+		return Token{}, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	return token, nil
+}
+
+// postForm POSTs data to the client's token endpoint, authenticating per the client's
+// configured auth_method, and returns the raw response body, if the request succeeded.
+func postForm(client Client, data url.Values) ([]byte, error) {
+	httpClient, authHeader, err := clientAuth(client, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply client authentication: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, client.Base, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform http request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to obtain oauth access token: status_code=%d response_body=%s", resp.StatusCode, string(respBody))
+	}
+
+	return respBody, nil
+}
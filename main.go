@@ -2,17 +2,14 @@ package main // import "github.com/stuarthicks/oauth2_token"
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"log/slog"
-	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -27,25 +24,78 @@ type Client struct {
 	Base   string `toml:"base"`
 	Id     string `toml:"id"`
 	Secret string `toml:"secret"`
+
+	// GrantType selects how a token is obtained. Defaults to "client_credentials" when unset.
+	GrantType string `toml:"grant_type"`
+
+	// AuthURL and RedirectPort are only used by the "authorization_code" grant. Scopes is used
+	// by the "authorization_code", "password", "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	// and "urn:ietf:params:oauth:grant-type:token-exchange" grants.
+	AuthURL      string   `toml:"auth_url"`
+	RedirectPort int      `toml:"redirect_port"`
+	Scopes       []string `toml:"scopes"`
+
+	// Username and Password are only used by the "password" grant.
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+
+	// Assertion is only used by the "urn:ietf:params:oauth:grant-type:jwt-bearer" grant.
+	Assertion string `toml:"assertion"`
+
+	// SubjectToken and Audience are only used by the
+	// "urn:ietf:params:oauth:grant-type:token-exchange" grant.
+	SubjectToken string `toml:"subject_token"`
+	Audience     string `toml:"audience"`
+
+	// CacheEncryption selects how the token cache file is stored on disk. The empty string
+	// (the default) keeps the historical plaintext-on-disk behaviour; "keyring" encrypts the
+	// cache with a key held in the OS keyring.
+	CacheEncryption string `toml:"cache_encryption"`
+
+	// DiscoveryURL, when set, is the OIDC issuer used to fetch
+	// "<issuer>/.well-known/openid-configuration" and derive Base and AuthURL, instead of
+	// requiring them to be configured directly.
+	DiscoveryURL string `toml:"discovery_url"`
+
+	// AuthMethod selects how the client authenticates itself to the token endpoint. Defaults
+	// to "client_secret_basic" when unset.
+	AuthMethod string `toml:"auth_method"`
+
+	// PrivateKeyFile and KeyID are only used by the "private_key_jwt" auth_method.
+	PrivateKeyFile string `toml:"private_key_file"`
+	KeyID          string `toml:"key_id"`
+
+	// ClientCertFile and ClientKeyFile are only used by the "tls_client_auth" auth_method.
+	ClientCertFile string `toml:"client_cert_file"`
+	ClientKeyFile  string `toml:"client_key_file"`
 }
 
-type ClientCredentials struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int    `json:"expires_in"`
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
 }
 
 var (
-	config     Config
-	configFile string
-	clientName string
-	printToken bool
+	config      Config
+	configFile  string
+	clientName  string
+	printToken  bool
+	printClaims bool
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+
 	flag.StringVar(&configFile, "f", "", "Path to config file")
 	flag.StringVar(&clientName, "c", "", "Oauth client name in config file")
 	flag.BoolVar(&printToken, "p", false, "Only print access token")
+	flag.BoolVar(&printClaims, "claims", false, "Validate and print the id_token claims as JSON")
 	flag.Parse()
 
 	if configFile == "" {
@@ -77,72 +127,78 @@ func main() {
 		os.Exit(1)
 	}
 
-	var cacheFile = getCacheFilePath(client.Base, client.Id)
-
-	if cacheExpired(cacheFile) {
-		var data = url.Values{}
-		data.Set("grant_type", "client_credentials")
-
-		req, err := http.NewRequest(http.MethodPost, client.Base, strings.NewReader(data.Encode()))
+	var discovery *oidcDiscoveryDocument
+	if client.DiscoveryURL != "" {
+		var err error
+		discovery, err = loadDiscoveryDocument(client.DiscoveryURL)
 		if err != nil {
 			slog.Error(
-				"failed to create http request",
+				"failed to load OIDC discovery document",
+				"discovery_url", client.DiscoveryURL,
 				"error", err.Error(),
 			)
 			os.Exit(1)
 		}
+		if client.Base == "" {
+			client.Base = discovery.TokenEndpoint
+		}
+		if client.AuthURL == "" {
+			client.AuthURL = discovery.AuthorizationEndpoint
+		}
+		warnIfGrantTypeUnsupported(client, discovery)
+	}
 
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(client.Id+":"+client.Secret)))
+	var cacheFile = getCacheFilePath(client.Base, client.Id)
+	var cache = newCache(client)
 
-		resp, err := http.DefaultClient.Do(req)
+	if cacheExpired(cache, cacheFile) {
+		respBody, err := obtainToken(context.Background(), cache, client, cacheFile)
 		if err != nil {
 			slog.Error(
-				"failed to perform http request",
+				"failed to obtain oauth access token",
 				"error", err.Error(),
 			)
 			os.Exit(1)
 		}
-		defer resp.Body.Close()
 
-		respBody, err := io.ReadAll(resp.Body)
-		if err != nil {
+		if err := cache.Write(cacheFile, respBody); err != nil {
 			slog.Error(
-				"failed to read response body",
+				"failed to write cache file",
+				"file", cacheFile,
 				"error", err.Error(),
 			)
 			os.Exit(1)
 		}
+	}
+
+	bs, err := cache.Read(cacheFile)
+	if err != nil {
+		slog.Error(
+			"failed to read cache file",
+			"file", cacheFile,
+			"error", err.Error(),
+		)
+		os.Exit(1)
+	}
 
-		if resp.StatusCode != http.StatusOK {
+	if printClaims {
+		var credentials Token
+		if err := json.NewDecoder(bytes.NewBuffer(bs)).Decode(&credentials); err != nil {
 			slog.Error(
-				"failed to obtain oauth access token",
-				"status_code", resp.StatusCode,
-				"response_body", string(respBody),
+				"failed to decode client credentials",
+				"error", err.Error(),
 			)
 			os.Exit(1)
 		}
 
-		f, err := os.Create(cacheFile)
-		if err != nil {
+		if err := printIDTokenClaims(credentials.IDToken, client, discovery); err != nil {
 			slog.Error(
-				"failed to write cache file",
-				"file", f,
+				"failed to validate id_token",
 				"error", err.Error(),
 			)
 			os.Exit(1)
 		}
-		_, _ = f.Write(respBody)
-	}
-
-	bs, err := os.ReadFile(cacheFile)
-	if err != nil {
-		slog.Error(
-			"failed to read cache file",
-			"file", cacheFile,
-			"error", err.Error(),
-		)
-		os.Exit(1)
+		os.Exit(0)
 	}
 
 	if !printToken {
@@ -150,7 +206,7 @@ func main() {
 		os.Exit(0)
 	}
 
-	var credentials ClientCredentials
+	var credentials Token
 	if err := json.NewDecoder(bytes.NewBuffer(bs)).Decode(&credentials); err != nil {
 		slog.Error(
 			"failed to decode client credentials",
@@ -163,6 +219,43 @@ func main() {
 	os.Exit(0)
 }
 
+// obtainToken fetches a fresh token for client, preferring a refresh_token grant over a full
+// re-auth when a previous cache file holds a refresh token.
+func obtainToken(ctx context.Context, cache Cache, client Client, cacheFile string) ([]byte, error) {
+	var issuer TokenIssuer
+	var prevRefreshToken string
+
+	if bs, err := cache.Read(cacheFile); err == nil {
+		var prev Token
+		if err := json.NewDecoder(bytes.NewBuffer(bs)).Decode(&prev); err == nil && prev.RefreshToken != "" {
+			prevRefreshToken = prev.RefreshToken
+			issuer = refreshTokenIssuer{client, prev.RefreshToken}
+		}
+	}
+
+	if issuer == nil {
+		var err error
+		issuer, err = newIssuer(client)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := issuer.Issue(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// RFC 6749 §6 allows a refresh response to omit refresh_token, meaning the existing one
+	// is still valid (many IdPs never rotate it). Carry it forward so the next expiry can
+	// still refresh instead of falling back to a full re-auth.
+	if token.RefreshToken == "" {
+		token.RefreshToken = prevRefreshToken
+	}
+
+	return json.Marshal(token)
+}
+
 // cacheFilename normalises the endpoint and clientID into a stable "key" that is used to locate
 // a cache file that contains the previous token for this client.
 func cacheFilename(endpoint, clientID string) string {
@@ -170,8 +263,9 @@ func cacheFilename(endpoint, clientID string) string {
 	return base64.URLEncoding.EncodeToString([]byte(s))
 }
 
-// getCacheFilePath returns the full path to a cache file. Respects XDG_CACHE_HOME if set.
-func getCacheFilePath(endpoint, clientID string) string {
+// cacheDir returns the directory cache files are stored under, creating it if necessary.
+// Respects XDG_CACHE_HOME if set.
+func cacheDir() string {
 	var cacheDir = os.Getenv("XDG_CACHE_HOME")
 	if cacheDir == "" {
 		home, _ := homedir.Dir()
@@ -180,17 +274,22 @@ func getCacheFilePath(endpoint, clientID string) string {
 	var oauth2TokenCacheDir = filepath.Join(cacheDir, "oauth2_token")
 	_ = os.MkdirAll(oauth2TokenCacheDir, 0750)
 
+	return oauth2TokenCacheDir
+}
+
+// getCacheFilePath returns the full path to a client's token cache file.
+func getCacheFilePath(endpoint, clientID string) string {
 	var oauth2TokenCacheFile = cacheFilename(endpoint, clientID) + ".json"
-	return filepath.Join(oauth2TokenCacheDir, oauth2TokenCacheFile)
+	return filepath.Join(cacheDir(), oauth2TokenCacheFile)
 }
 
 // cacheExpired checks the `expires` in a cache file to determine if the file has expired or not.
-func cacheExpired(f string) bool {
-	bs, err := os.ReadFile(f)
+func cacheExpired(cache Cache, f string) bool {
+	bs, err := cache.Read(f)
 	if err != nil {
 		return true // if we couldn't read the file, then it probably needs to be created
 	}
-	var credentials ClientCredentials
+	var credentials Token
 	if err := json.NewDecoder(bytes.NewBuffer(bs)).Decode(&credentials); err != nil {
 		return true // if we couldn't parse the file, then let's just blat it with valid creds
 	}
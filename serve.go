@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/mitchellh/go-homedir"
+)
+
+// daemon holds the live config and most recently refreshed tokens for the "serve" subcommand.
+type daemon struct {
+	configFile string
+
+	mu     sync.RWMutex
+	config Config
+	tokens map[string]Token
+}
+
+// runServe runs oauth2_token as a background daemon that proactively refreshes tokens and
+// serves them over a local unix domain socket. It leaves the one-shot CLI behaviour untouched.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	var configFile, socketPath string
+	fs.StringVar(&configFile, "f", "", "Path to config file")
+	fs.StringVar(&socketPath, "socket", defaultSocketPath(), "Path to unix domain socket to serve tokens on")
+	_ = fs.Parse(args)
+
+	if configFile == "" {
+		home, _ := homedir.Dir()
+		configFile = filepath.Join(home, ".oauth.toml")
+	}
+
+	d := &daemon{configFile: configFile, tokens: map[string]Token{}}
+	if err := d.loadConfig(); err != nil {
+		slog.Error("failed to parse config file", "config_file", configFile, "error", err.Error())
+		os.Exit(1)
+	}
+
+	for name := range d.config.Clients {
+		go d.keepFresh(name)
+	}
+	go d.watchConfig()
+
+	if err := os.RemoveAll(socketPath); err != nil {
+		slog.Error("failed to remove stale socket", "socket", socketPath, "error", err.Error())
+		os.Exit(1)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		slog.Error("failed to listen on unix socket", "socket", socketPath, "error", err.Error())
+		os.Exit(1)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /token/{client_name}", d.handleToken)
+	mux.HandleFunc("GET /token/{client_name}/header", d.handleTokenHeader)
+
+	slog.Info("serving tokens", "socket", socketPath, "config_file", configFile)
+	if err := http.Serve(listener, mux); err != nil {
+		slog.Error("serve failed", "error", err.Error())
+		os.Exit(1)
+	}
+}
+
+// loadConfig (re)reads the TOML config file into the daemon's config.
+func (d *daemon) loadConfig() error {
+	var cfg Config
+	if _, err := toml.DecodeFile(d.configFile, &cfg); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.config = cfg
+	d.mu.Unlock()
+
+	return nil
+}
+
+// watchConfig polls the config file for changes and reloads it, starting refresh loops for
+// any newly added clients.
+func (d *daemon) watchConfig() {
+	var lastMod time.Time
+	if fi, err := os.Stat(d.configFile); err == nil {
+		lastMod = fi.ModTime()
+	}
+
+	for {
+		time.Sleep(30 * time.Second)
+
+		fi, err := os.Stat(d.configFile)
+		if err != nil || !fi.ModTime().After(lastMod) {
+			continue
+		}
+		lastMod = fi.ModTime()
+
+		slog.Info("config file changed, reloading", "config_file", d.configFile)
+		before := d.clientNames()
+
+		if err := d.loadConfig(); err != nil {
+			slog.Error("failed to reload config file", "config_file", d.configFile, "error", err.Error())
+			continue
+		}
+
+		for name := range d.config.Clients {
+			if !slices.Contains(before, name) {
+				go d.keepFresh(name)
+			}
+		}
+	}
+}
+
+// clientNames returns the names of the clients currently loaded from config.
+func (d *daemon) clientNames() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	names := make([]string, 0, len(d.config.Clients))
+	for name := range d.config.Clients {
+		names = append(names, name)
+	}
+	return names
+}
+
+// keepFresh proactively refreshes the token for a named client, sleeping until a jittered
+// point near the token's expiry before refreshing again. It exits once the client is removed
+// from config.
+func (d *daemon) keepFresh(name string) {
+	for {
+		d.mu.RLock()
+		client, ok := d.config.Clients[name]
+		d.mu.RUnlock()
+		if !ok {
+			return
+		}
+
+		cacheFile := getCacheFilePath(client.Base, client.Id)
+		cache := newCache(client)
+
+		if client.GrantType == "authorization_code" && !hasCachedRefreshToken(cache, cacheFile) {
+			slog.Warn(
+				"skipping interactive authorization_code grant, no cached refresh_token yet; run the CLI once to authenticate",
+				"client_name", name,
+			)
+			time.Sleep(30 * time.Second)
+			continue
+		}
+
+		respBody, err := obtainToken(context.Background(), cache, client, cacheFile)
+		if err != nil {
+			slog.Error("failed to refresh token", "client_name", name, "error", err.Error())
+			time.Sleep(30 * time.Second)
+			continue
+		}
+
+		var token Token
+		if err := json.Unmarshal(respBody, &token); err != nil {
+			slog.Error("failed to decode token", "client_name", name, "error", err.Error())
+			time.Sleep(30 * time.Second)
+			continue
+		}
+		if err := cache.Write(cacheFile, respBody); err != nil {
+			slog.Error("failed to write cache file", "client_name", name, "error", err.Error())
+		}
+
+		d.mu.Lock()
+		d.tokens[name] = token
+		d.mu.Unlock()
+
+		delay := jitteredRefreshDelay(token.ExpiresIn)
+		slog.Info("token refreshed", "client_name", name, "next_refresh", delay.String())
+		time.Sleep(delay)
+	}
+}
+
+// hasCachedRefreshToken reports whether the cache at cacheFile already holds a refresh_token,
+// which is required before an interactive grant (e.g. authorization_code) can be refreshed
+// unattended.
+func hasCachedRefreshToken(cache Cache, cacheFile string) bool {
+	bs, err := cache.Read(cacheFile)
+	if err != nil {
+		return false
+	}
+
+	var token Token
+	if err := json.Unmarshal(bs, &token); err != nil {
+		return false
+	}
+
+	return token.RefreshToken != ""
+}
+
+// jitteredRefreshDelay returns a delay around 90% of expiresIn, jittered by up to 5% of
+// expiresIn to avoid every client refreshing in lockstep.
+func jitteredRefreshDelay(expiresIn int) time.Duration {
+	if expiresIn <= 0 {
+		return time.Minute
+	}
+
+	total := time.Duration(expiresIn) * time.Second
+	jitter := time.Duration(rand.Int63n(int64(total)/20 + 1))
+	return total*9/10 - jitter
+}
+
+// handleToken returns the current access token for a client.
+func (d *daemon) handleToken(w http.ResponseWriter, r *http.Request) {
+	token, ok := d.tokenFor(r.PathValue("client_name"))
+	if !ok {
+		http.Error(w, "unknown or not-yet-refreshed client", http.StatusNotFound)
+		return
+	}
+	fmt.Fprint(w, token.AccessToken)
+}
+
+// handleTokenHeader returns a ready-to-use "Authorization: Bearer ..." header value.
+func (d *daemon) handleTokenHeader(w http.ResponseWriter, r *http.Request) {
+	token, ok := d.tokenFor(r.PathValue("client_name"))
+	if !ok {
+		http.Error(w, "unknown or not-yet-refreshed client", http.StatusNotFound)
+		return
+	}
+	fmt.Fprintf(w, "Authorization: Bearer %s", token.AccessToken)
+}
+
+func (d *daemon) tokenFor(name string) (Token, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	token, ok := d.tokens[name]
+	return token, ok
+}
+
+// defaultSocketPath returns $XDG_RUNTIME_DIR/oauth2_token.sock, falling back to the system
+// temp dir when XDG_RUNTIME_DIR is unset.
+func defaultSocketPath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "oauth2_token.sock")
+}